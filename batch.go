@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const batchURLExpiry = 15 * time.Minute
+
+// batchSigningSecret is the HMAC key used to sign/verify batch transfer
+// URLs. It's loaded from BATCH_SIGNING_SECRET once, falling back to a
+// random per-process secret (fine for a single instance, but multi-instance
+// deployments behind a load balancer must set BATCH_SIGNING_SECRET so all
+// instances agree).
+var batchSigningSecret = loadBatchSigningSecret()
+
+func loadBatchSigningSecret() []byte {
+	if secret := os.Getenv("BATCH_SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	slog.Warn("BATCH_SIGNING_SECRET not set; generating an ephemeral secret for this process")
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("failed to generate batch signing secret: %v", err))
+	}
+	return buf
+}
+
+// BatchObject is one object a client wants to upload or download in a
+// batch request, identified by its content digest (oid).
+type BatchObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// BatchRequest is the body of POST /api/v2/batch.
+type BatchRequest struct {
+	Operation string        `json:"operation"` // "upload" or "download"
+	Objects   []BatchObject `json:"objects"`
+}
+
+// BatchObjectResult reports, per requested object, whether it already
+// exists and the short-lived URL to use for the follow-up transfer.
+type BatchObjectResult struct {
+	OID         string `json:"oid"`
+	Exists      bool   `json:"exists"`
+	UploadURL   string `json:"uploadUrl,omitempty"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// BatchResponse is the body returned by POST /api/v2/batch.
+type BatchResponse struct {
+	Objects []BatchObjectResult `json:"objects"`
+}
+
+// handleBatch lets clients synchronize many objects in one round-trip: for
+// each requested oid it reports whether the object is already stored, and
+// returns a signed URL for the actual upload (PUT) or download (GET).
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxUploadSize)).Decode(&req); err != nil {
+		http.Error(w, "Invalid batch request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Operation != "upload" && req.Operation != "download" {
+		http.Error(w, `operation must be "upload" or "download"`, http.StatusBadRequest)
+		return
+	}
+
+	for _, obj := range req.Objects {
+		if !isValidDigest(obj.OID) {
+			http.Error(w, "oid must be a 64-character hex sha256 digest", http.StatusBadRequest)
+			return
+		}
+	}
+
+	storage, err := s.ensureStorage()
+	if err != nil {
+		slog.Error("failed to initialize storage backend", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, r.Host)
+
+	results := make([]BatchObjectResult, len(req.Objects))
+	var wg sync.WaitGroup
+	wg.Add(len(req.Objects))
+	for i, obj := range req.Objects {
+		go func(i int, obj BatchObject) {
+			defer wg.Done()
+			results[i] = s.batchObjectResult(r.Context(), storage, baseURL, req.Operation, obj)
+		}(i, obj)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{Objects: results})
+}
+
+func (s *Server) batchObjectResult(ctx context.Context, storage Storage, baseURL, operation string, obj BatchObject) BatchObjectResult {
+	result := BatchObjectResult{OID: obj.OID}
+
+	_, err := storage.Stat(ctx, obj.OID)
+	result.Exists = err == nil
+
+	switch operation {
+	case "upload":
+		if !result.Exists {
+			result.UploadURL = signedBatchObjectURL(baseURL, obj.OID, batchURLExpiry)
+		}
+	case "download":
+		if !result.Exists {
+			result.Error = "object not found"
+			return result
+		}
+		result.DownloadURL = signedBatchObjectURL(baseURL, obj.OID, batchURLExpiry)
+	}
+
+	return result
+}
+
+// signedBatchObjectURL builds a time-limited URL for /api/v2/batch/objects/<oid>
+// authenticated by an HMAC signature over the path and expiry.
+func signedBatchObjectURL(baseURL, oid string, expiry time.Duration) string {
+	exp := time.Now().Add(expiry).Unix()
+	path := batchObjectPath(oid)
+	sig := signBatchPath(path, exp)
+	return fmt.Sprintf("%s%s?exp=%d&sig=%s", baseURL, path, exp, sig)
+}
+
+func batchObjectPath(oid string) string {
+	return "/api/v2/batch/objects/" + oid
+}
+
+func signBatchPath(path string, exp int64) string {
+	mac := hmac.New(sha256.New, batchSigningSecret)
+	mac.Write([]byte(path))
+	mac.Write([]byte(":"))
+	mac.Write([]byte(strconv.FormatInt(exp, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyBatchSignature checks a request's ?exp=&sig= query parameters
+// against the path they were issued for.
+func verifyBatchSignature(r *http.Request) bool {
+	expStr := r.URL.Query().Get("exp")
+	sig := r.URL.Query().Get("sig")
+	if expStr == "" || sig == "" {
+		return false
+	}
+
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+
+	expected := signBatchPath(r.URL.Path, exp)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(sig)) == 1
+}
+
+// handleBatchObject serves the signed-URL follow-up transfer for a single
+// batch object: PUT to upload, GET to download.
+func (s *Server) handleBatchObject(w http.ResponseWriter, r *http.Request) {
+	if !verifyBatchSignature(r) {
+		http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	oid := filepath.Base(r.URL.Path)
+
+	storage, err := s.ensureStorage()
+	if err != nil {
+		slog.Error("failed to initialize storage backend", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.handleBatchObjectUpload(w, r, storage, oid)
+	case http.MethodGet:
+		s.handleBatchObjectDownload(w, r, storage, oid)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleBatchObjectUpload(w http.ResponseWriter, r *http.Request, storage Storage, oid string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	data, err := verifyDigest(r.Body, oid)
+	if err != nil {
+		// Check if the error is due to request body being too large
+		if err.Error() == "http: request body too large" {
+			http.Error(w, fmt.Sprintf("File too large. Maximum size is %d bytes", maxUploadSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		slog.Warn("batch upload content doesn't match oid", "oid", oid, "error", err)
+		http.Error(w, "Uploaded content does not match oid", http.StatusBadRequest)
+		return
+	}
+
+	if err := storage.Put(r.Context(), oid, bytes.NewReader(data), int64(len(data))); err != nil {
+		slog.Error("failed to store batch upload", "error", err, "oid", oid)
+		http.Error(w, "Could not save file", http.StatusInternalServerError)
+		return
+	}
+
+	// Without a metadata sidecar this object would be invisible to the
+	// janitor (lifecycle.go only sweeps by sidecar) and undeletable via
+	// DELETE /api/v2/<key>, the same way handleUpload and
+	// finalizeTusUpload write one for their own upload paths.
+	deleteKey, err := generateDeleteKey()
+	if err != nil {
+		slog.Error("failed to generate delete key", "error", err, "oid", oid)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := writeMetadata(oid, fileMetadata{
+		CreatedAt: time.Now(),
+		Size:      int64(len(data)),
+		SHA256:    oid,
+		DeleteKey: deleteKey,
+	}); err != nil {
+		slog.Error("failed to write batch upload metadata", "error", err, "oid", oid)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("batch object uploaded", "oid", oid, "size", len(data))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleBatchObjectDownload(w http.ResponseWriter, r *http.Request, storage Storage, oid string) {
+	file, size, err := storage.Get(r.Context(), oid)
+	if err != nil {
+		slog.Error("failed to open batch object", "error", err, "oid", oid)
+		http.Error(w, "Could not find the file", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	if _, err := io.Copy(w, file); err != nil {
+		slog.Error("failed to send batch object", "error", err, "oid", oid)
+	} else {
+		slog.Info("batch object downloaded", "oid", oid)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// Test case: a batch upload request reports an object as missing, and the
+// signed uploadUrl it returns accepts the matching content.
+func TestBatchUploadRoundTrip(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	payload := generateRandomBytes(2048)
+	digest := sha256.Sum256(payload)
+	oid := hex.EncodeToString(digest[:])
+
+	reqBody, _ := json.Marshal(BatchRequest{
+		Operation: "upload",
+		Objects:   []BatchObject{{OID: oid, Size: int64(len(payload))}},
+	})
+
+	resp, err := http.Post(ts.URL+"/api/v2/batch", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to post batch request: %v", err)
+	}
+	var batchResp BatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batchResp); err != nil {
+		t.Fatalf("failed to decode batch response: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(batchResp.Objects) != 1 {
+		t.Fatalf("expected 1 object result; got %d", len(batchResp.Objects))
+	}
+	result := batchResp.Objects[0]
+	if result.Exists {
+		t.Error("expected object to not exist yet")
+	}
+	if result.UploadURL == "" {
+		t.Fatal("expected a non-empty uploadUrl")
+	}
+
+	putReq, err := http.NewRequest(http.MethodPut, result.UploadURL, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to build PUT request: %v", err)
+	}
+	putResp, err := http.DefaultClient.Do(putReq)
+	if err != nil {
+		t.Fatalf("failed to PUT to upload URL: %v", err)
+	}
+	defer putResp.Body.Close()
+	if putResp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 from upload URL; got %v", putResp.StatusCode)
+	}
+
+	// A second batch request for the same oid should now report it as existing.
+	resp, err = http.Post(ts.URL+"/api/v2/batch", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to post second batch request: %v", err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&batchResp)
+	if !batchResp.Objects[0].Exists {
+		t.Error("expected object to exist after upload")
+	}
+}
+
+// Test case: signed batch URLs are rejected once tampered with.
+func TestBatchObjectRejectsBadSignature(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v2/batch/objects/some-oid?exp=9999999999&sig=deadbeef")
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for invalid signature; got %v", resp.StatusCode)
+	}
+}
+
+// Test case: a batch download request for a missing object reports an error.
+func TestBatchDownloadMissingObject(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	reqBody, _ := json.Marshal(BatchRequest{
+		Operation: "download",
+		Objects:   []BatchObject{{OID: "0000000000000000000000000000000000000000000000000000000000000000"}},
+	})
+
+	resp, err := http.Post(ts.URL+"/api/v2/batch", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to post batch request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var batchResp BatchResponse
+	json.NewDecoder(resp.Body).Decode(&batchResp)
+	if len(batchResp.Objects) != 1 {
+		t.Fatalf("expected 1 object result; got %d", len(batchResp.Objects))
+	}
+	if batchResp.Objects[0].Error == "" {
+		t.Error("expected an error for a missing object")
+	}
+}
+
+// Test case: an oid that isn't a valid sha256 digest is rejected outright,
+// instead of being handed to the storage backend as a key.
+func TestBatchRejectsInvalidOID(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	reqBody, _ := json.Marshal(BatchRequest{
+		Operation: "download",
+		Objects:   []BatchObject{{OID: "../../../../etc/passwd"}},
+	})
+
+	resp, err := http.Post(ts.URL+"/api/v2/batch", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to post batch request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid oid; got %v", resp.StatusCode)
+	}
+}
+
+// Test case: an object uploaded through the batch signed-URL PUT gets a
+// metadata sidecar, the same way handleUpload and finalizeTusUpload do for
+// their own upload paths, so it can later be deleted with its delete_key.
+func TestBatchUploadWritesMetadata(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	payload := generateRandomBytes(1024)
+	digest := sha256.Sum256(payload)
+	oid := hex.EncodeToString(digest[:])
+
+	reqBody, _ := json.Marshal(BatchRequest{
+		Operation: "upload",
+		Objects:   []BatchObject{{OID: oid, Size: int64(len(payload))}},
+	})
+	resp, err := http.Post(ts.URL+"/api/v2/batch", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to post batch request: %v", err)
+	}
+	var batchResp BatchResponse
+	json.NewDecoder(resp.Body).Decode(&batchResp)
+	resp.Body.Close()
+
+	putReq, err := http.NewRequest(http.MethodPut, batchResp.Objects[0].UploadURL, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to build PUT request: %v", err)
+	}
+	putResp, err := http.DefaultClient.Do(putReq)
+	if err != nil {
+		t.Fatalf("failed to PUT to upload URL: %v", err)
+	}
+	putResp.Body.Close()
+
+	meta, err := readMetadata(oid)
+	if err != nil {
+		t.Fatalf("expected a metadata sidecar for the batch-uploaded object: %v", err)
+	}
+	if meta.DeleteKey == "" {
+		t.Error("expected metadata to record a non-empty DeleteKey")
+	}
+
+	// The delete_key from metadata should authenticate a DELETE, the same
+	// as for any other upload path.
+	delReq, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v2/"+oid, nil)
+	delReq.Header.Set("X-Delete-Key", meta.DeleteKey)
+	delResp, err := http.DefaultClient.Do(delReq)
+	if err != nil {
+		t.Fatalf("failed to send delete: %v", err)
+	}
+	defer delResp.Body.Close()
+	if delResp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 deleting batch-uploaded object; got %v", delResp.StatusCode)
+	}
+}
+
+// Test case: a batch upload PUT whose body exceeds maxUploadSize is
+// reported as 413, not as a generic digest mismatch.
+func TestBatchUploadTooLarge(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	reqBody, _ := json.Marshal(BatchRequest{
+		Operation: "upload",
+		Objects:   []BatchObject{{OID: "0000000000000000000000000000000000000000000000000000000000000000"}},
+	})
+	resp, err := http.Post(ts.URL+"/api/v2/batch", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		t.Fatalf("failed to post batch request: %v", err)
+	}
+	var batchResp BatchResponse
+	json.NewDecoder(resp.Body).Decode(&batchResp)
+	resp.Body.Close()
+
+	payload := generateRandomBytes(maxUploadSize + 1024) // Slightly over limit
+	putReq, err := http.NewRequest(http.MethodPut, batchResp.Objects[0].UploadURL, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to build PUT request: %v", err)
+	}
+	putResp, err := http.DefaultClient.Do(putReq)
+	if err != nil {
+		t.Fatalf("failed to PUT to upload URL: %v", err)
+	}
+	defer putResp.Body.Close()
+
+	if putResp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for oversized batch upload; got %v", putResp.StatusCode)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultCORSAllowedOrigins covers the hosted Excalidraw app and any
+	// subdomain deployment when CORS_ALLOWED_ORIGINS isn't set.
+	defaultCORSAllowedOrigins = "https://excalidraw.com,https://*.excalidraw.com"
+	defaultCORSMaxAge         = 600 // seconds
+)
+
+// CORSConfig controls which origins, methods, and headers are allowed for
+// cross-origin requests against the upload/download API.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         int
+}
+
+// loadCORSConfig builds a CORSConfig from CORS_* environment variables,
+// falling back to sane defaults for an Excalidraw deployment.
+func loadCORSConfig() CORSConfig {
+	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = defaultCORSAllowedOrigins
+	}
+
+	maxAge := defaultCORSMaxAge
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			maxAge = parsed
+		}
+	}
+
+	return CORSConfig{
+		AllowedOrigins: splitAndTrim(origins),
+		AllowedMethods: []string{"GET", "POST", "HEAD", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Upload-Length", "Upload-Offset", "Upload-Defer-Length", "Tus-Resumable", "X-Expires-In"},
+		ExposedHeaders: []string{"X-Data-Key", "Location", "Upload-Offset", "Upload-Length", "ETag"},
+		MaxAge:         maxAge,
+	}
+}
+
+func splitAndTrim(s string) []string {
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// allowsOrigin reports whether origin matches one of the configured
+// allowed origins. Supports an exact "*" wildcard and a leading "*."
+// suffix wildcard (e.g. "*.excalidraw.com").
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(origin, strings.TrimPrefix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnsafeMethod reports whether method can mutate state, as opposed to
+// GET/HEAD/OPTIONS which are safe to allow cross-origin regardless of
+// whether the response headers are readable by the caller.
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// middleware wraps next with CORS handling: it answers OPTIONS preflight
+// directly, sets Access-Control-Allow-Origin only for matching origins,
+// and rejects unsafe methods from disallowed origins with 403.
+func (c CORSConfig) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := c.allowsOrigin(origin)
+
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Vary", "Origin")
+		}
+		if len(c.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+		}
+
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if origin != "" && !allowed && isUnsafeMethod(r.Method) {
+			slog.Warn("rejecting cross-origin request from disallowed origin", "origin", origin, "method", r.Method)
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
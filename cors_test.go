@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"https://excalidraw.com", "*.trusted.example"},
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type"},
+		ExposedHeaders: []string{"X-Data-Key"},
+		MaxAge:         300,
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cfg := testCORSConfig()
+	handler := cfg.middleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("preflight request should not reach the wrapped handler")
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v2/post/", nil)
+	req.Header.Set("Origin", "https://excalidraw.com")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204 for preflight; got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got == "" {
+		t.Error("expected Access-Control-Allow-Methods to be set")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got == "" {
+		t.Error("expected Access-Control-Allow-Headers to be set")
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "300" {
+		t.Errorf("expected Access-Control-Max-Age: 300; got %q", got)
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	cfg := testCORSConfig()
+	called := false
+	handler := cfg.middleware(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/post/", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for unsafe method from disallowed origin; got %d", rec.Code)
+	}
+	if called {
+		t.Error("wrapped handler should not run for a rejected request")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Access-Control-Allow-Origin; got %q", got)
+	}
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	cfg := testCORSConfig()
+	handler := cfg.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, origin := range []string{"https://excalidraw.com", "https://sub.trusted.example"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/post/", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("origin %s: expected 200; got %d", origin, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("origin %s: expected Access-Control-Allow-Origin echoed back; got %q", origin, got)
+		}
+		if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Data-Key" {
+			t.Errorf("origin %s: expected Access-Control-Expose-Headers: X-Data-Key; got %q", origin, got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"regexp"
+)
+
+// digestPattern matches the hex-encoded SHA-256 shape of a content-addressed
+// key. Anything a client supplies as an oid must match this before it's
+// allowed anywhere near a storage key, since storage backends like the fs
+// driver build paths directly from it.
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// isValidDigest reports whether key looks like a SHA-256 digest, as
+// produced by PutContentAddressed. It does not check that anything is
+// actually stored under key.
+func isValidDigest(key string) bool {
+	return digestPattern.MatchString(key)
+}
+
+// etagFor formats a content digest as a weak-free strong ETag, per the
+// "sha256-<digest>" convention used for both uploads and downloads.
+func etagFor(digest string) string {
+	return `"sha256-` + digest + `"`
+}
+
+// PutContentAddressed streams r into storage under a key derived from its
+// SHA-256 digest, so identical uploads dedup onto the same object instead
+// of consuming disk for every request. It buffers to a local temp file
+// while hashing, then only touches storage once the digest is known.
+func PutContentAddressed(ctx context.Context, storage Storage, r io.Reader) (key string, size int64, err error) {
+	tmp, err := os.CreateTemp("", "upload-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	hasher := sha256.New()
+	written, copyErr := io.Copy(tmp, io.TeeReader(r, hasher))
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		return "", 0, copyErr
+	}
+	if closeErr != nil {
+		return "", 0, closeErr
+	}
+
+	digest := hex.EncodeToString(hasher.Sum(nil))
+
+	if _, err := storage.Stat(ctx, digest); err == nil {
+		// Identical content already stored; dedup instead of re-uploading.
+		return digest, written, nil
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	if err := storage.Put(ctx, digest, f, written); err != nil {
+		return "", 0, err
+	}
+
+	return digest, written, nil
+}
+
+// verifyDigest reads r fully, returning its bytes alongside an error if its
+// SHA-256 digest doesn't match the expected key.
+//
+// This buffers the whole of r in memory, so it's only suitable for content
+// with a bounded, already-enforced size (e.g. a batch upload capped by
+// maxUploadSize). For serving arbitrarily large downloads, use
+// verifyDigestSpooled instead.
+func verifyDigest(r io.Reader, expectedKey string) ([]byte, error) {
+	hasher := sha256.New()
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(io.MultiWriter(buf, hasher), r); err != nil {
+		return nil, err
+	}
+
+	if digest := hex.EncodeToString(hasher.Sum(nil)); digest != expectedKey {
+		return nil, &digestMismatchError{expected: expectedKey, actual: digest}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// verifyDigestSpooled streams r into a local temp file while hashing it, the
+// same way PutContentAddressed spools an upload, so integrity can be
+// verified before any bytes reach the client without holding the whole
+// object in memory. On success it returns an open handle to the spooled
+// copy, positioned at the start, and a cleanup func the caller must invoke
+// once done reading. On a digest mismatch the spooled copy is cleaned up
+// before returning.
+func verifyDigestSpooled(r io.Reader, expectedKey string) (spooled *os.File, size int64, cleanup func(), err error) {
+	tmp, err := os.CreateTemp("", "download-*.tmp")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	tmpPath := tmp.Name()
+	cleanup = func() { os.Remove(tmpPath) }
+
+	hasher := sha256.New()
+	written, copyErr := io.Copy(tmp, io.TeeReader(r, hasher))
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		cleanup()
+		return nil, 0, nil, copyErr
+	}
+	if closeErr != nil {
+		cleanup()
+		return nil, 0, nil, closeErr
+	}
+
+	if digest := hex.EncodeToString(hasher.Sum(nil)); digest != expectedKey {
+		cleanup()
+		return nil, 0, nil, &digestMismatchError{expected: expectedKey, actual: digest}
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+
+	return f, written, cleanup, nil
+}
+
+// digestMismatchError indicates stored content doesn't hash to its own key,
+// meaning it was corrupted (or replaced) after being written.
+type digestMismatchError struct {
+	expected string
+	actual   string
+}
+
+func (e *digestMismatchError) Error() string {
+	return "dedup: stored content digest " + e.actual + " does not match key " + e.expected
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Test case: concurrent identical uploads dedup onto a single stored file.
+func TestConcurrentIdenticalUploadsDedup(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	payload := generateRandomBytes(4096)
+	const concurrency = 8
+
+	keys := make([]string, concurrency)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			req, err := http.NewRequest("POST", ts.URL+"/api/v2/post/", bytes.NewReader(payload))
+			if err != nil {
+				t.Errorf("failed to create request: %v", err)
+				return
+			}
+			req.Header.Set("Origin", validOrigin)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("failed to send request: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			var uploadResp UploadResponse
+			if err := json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
+				t.Errorf("failed to decode response: %v", err)
+				return
+			}
+			keys[i] = uploadResp.DataKey
+		}(i)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if key != keys[0] {
+			t.Errorf("expected all uploads to dedup to the same key; got %q and %q", keys[0], key)
+		}
+	}
+
+	storedData, err := os.ReadFile(filepath.Join(testDataDir, keys[0]))
+	if err != nil {
+		t.Fatalf("failed to read stored file: %v", err)
+	}
+	if !bytes.Equal(storedData, payload) {
+		t.Error("stored file content doesn't match the uploaded payload")
+	}
+}
+
+// Test case: a download whose stored bytes no longer match its key's digest
+// is rejected rather than served.
+func TestCorruptedFileDetection(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	payload := generateRandomBytes(1024)
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v2/post/", bytes.NewReader(payload))
+	req.Header.Set("Origin", validOrigin)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to upload test data: %v", err)
+	}
+	var uploadResp UploadResponse
+	json.NewDecoder(resp.Body).Decode(&uploadResp)
+	resp.Body.Close()
+
+	// Tamper with the stored file directly, bypassing the store.
+	filePath := filepath.Join(testDataDir, uploadResp.DataKey)
+	if err := os.WriteFile(filePath, generateRandomBytes(1024), 0644); err != nil {
+		t.Fatalf("failed to corrupt stored file: %v", err)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v2/" + uploadResp.DataKey)
+	if err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected status 502 for corrupted file; got %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	metadataSuffix = ".meta.json"
+
+	// defaultJanitorInterval is how often the janitor sweeps dataDir for
+	// expired files and quota violations when JANITOR_INTERVAL isn't set.
+	defaultJanitorInterval = 5 * time.Minute
+)
+
+// fileMetadata is the sidecar record written alongside every stored object,
+// used by the janitor to expire files and by handleDelete to authenticate
+// deletions.
+type fileMetadata struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Size      int64      `json:"size"`
+	SHA256    string     `json:"sha256"`
+	DeleteKey string     `json:"delete_key"`
+}
+
+func metadataPath(key string) string {
+	return filepath.Join(dataDir, key+metadataSuffix)
+}
+
+func writeMetadata(key string, meta fileMetadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metadataPath(key), data, 0644)
+}
+
+func readMetadata(key string) (fileMetadata, error) {
+	var meta fileMetadata
+	data, err := os.ReadFile(metadataPath(key))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+func deleteMetadata(key string) error {
+	err := os.Remove(metadataPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// generateDeleteKey returns a random token clients must present to delete
+// an upload they created.
+func generateDeleteKey() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// maxExpiry returns the maximum X-Expires-In clients may request, from the
+// MAX_EXPIRY environment variable (seconds). Zero means unlimited.
+func maxExpiry() time.Duration {
+	v := os.Getenv("MAX_EXPIRY")
+	if v == "" {
+		return 0
+	}
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// maxTotalBytes returns the disk quota enforced by the janitor, from the
+// MAX_TOTAL_BYTES environment variable. Zero means unlimited.
+func maxTotalBytes() int64 {
+	v := os.Getenv("MAX_TOTAL_BYTES")
+	if v == "" {
+		return 0
+	}
+	bytes, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || bytes <= 0 {
+		return 0
+	}
+	return bytes
+}
+
+// janitorInterval returns how often the janitor sweeps dataDir, from the
+// JANITOR_INTERVAL environment variable (seconds).
+func janitorInterval() time.Duration {
+	v := os.Getenv("JANITOR_INTERVAL")
+	if v == "" {
+		return defaultJanitorInterval
+	}
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds <= 0 {
+		return defaultJanitorInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// startJanitor runs janitorSweep on a ticker until the process exits. It
+// does not block the caller.
+func (s *Server) startJanitor() {
+	interval := janitorInterval()
+	slog.Info("starting janitor", "interval", interval, "maxTotalBytes", maxTotalBytes())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.janitorSweep()
+		}
+	}()
+}
+
+// janitorSweep removes expired objects and their metadata, then evicts the
+// least-recently-written objects (LRU by metadata mtime) until storage is
+// back under MAX_TOTAL_BYTES, if a quota is configured.
+//
+// It discovers objects by listing the metadata sidecars under dataDir
+// rather than dataDir's object files directly, and deletes through the
+// Storage interface rather than os.Remove, so eviction and expiry work the
+// same way regardless of STORAGE_BACKEND: with s3/gcs backends the object
+// bytes live in the bucket, not dataDir, and only the sidecars are local.
+func (s *Server) janitorSweep() {
+	storage, err := s.ensureStorage()
+	if err != nil {
+		slog.Error("janitor: failed to initialize storage backend", "error", err)
+		return
+	}
+
+	now := time.Now()
+
+	// Abandoned resumable uploads (created but never PATCHed to
+	// completion) have their own expiry, tracked by the tus store rather
+	// than a metadata sidecar; sweep those too so they don't accumulate
+	// disk usage forever.
+	if tusStore, err := s.ensureTusStore(); err != nil {
+		slog.Error("janitor: failed to initialize tus store", "error", err)
+	} else {
+		tusStore.Sweep(now)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("janitor: failed to read data directory", "error", err)
+		}
+		return
+	}
+
+	ctx := context.Background()
+	var totalBytes int64
+	type liveFile struct {
+		key     string
+		modTime time.Time
+		size    int64
+	}
+	var live []liveFile
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !hasMetadataSuffix(name) {
+			continue
+		}
+		key := strings.TrimSuffix(name, metadataSuffix)
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		meta, err := readMetadata(key)
+		if err != nil {
+			continue
+		}
+
+		if meta.ExpiresAt != nil && meta.ExpiresAt.Before(now) {
+			slog.Info("janitor: removing expired file", "key", key)
+			if err := storage.Delete(ctx, key); err != nil {
+				slog.Error("janitor: failed to delete expired object", "error", err, "key", key)
+				continue
+			}
+			deleteMetadata(key)
+			continue
+		}
+
+		totalBytes += meta.Size
+		live = append(live, liveFile{key: key, modTime: info.ModTime(), size: meta.Size})
+	}
+
+	quota := maxTotalBytes()
+	if quota == 0 || totalBytes <= quota {
+		return
+	}
+
+	sort.Slice(live, func(i, j int) bool { return live[i].modTime.Before(live[j].modTime) })
+
+	for _, f := range live {
+		if totalBytes <= quota {
+			break
+		}
+		slog.Info("janitor: evicting file over quota", "key", f.key, "size", f.size)
+		if err := storage.Delete(ctx, f.key); err != nil {
+			slog.Error("janitor: failed to evict file", "error", err, "key", f.key)
+			continue
+		}
+		deleteMetadata(f.key)
+		totalBytes -= f.size
+	}
+}
+
+func hasMetadataSuffix(name string) bool {
+	return len(name) > len(metadataSuffix) && name[len(name)-len(metadataSuffix):] == metadataSuffix
+}
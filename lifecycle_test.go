@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test case: an upload with X-Expires-In records an expiry and returns it.
+func TestUploadWithExpiry(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	payload := generateRandomBytes(512)
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v2/post/", bytes.NewReader(payload))
+	req.Header.Set("Origin", validOrigin)
+	req.Header.Set("X-Expires-In", "3600")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var uploadResp UploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if uploadResp.DeleteKey == "" {
+		t.Error("expected a non-empty DeleteKey")
+	}
+	if uploadResp.Expiry == nil {
+		t.Fatal("expected a non-nil Expiry")
+	}
+
+	meta, err := readMetadata(uploadResp.DataKey)
+	if err != nil {
+		t.Fatalf("failed to read metadata: %v", err)
+	}
+	if meta.ExpiresAt == nil {
+		t.Error("expected metadata to record an expiry")
+	}
+}
+
+// Test case: DELETE requires the delete_key returned at upload time.
+func TestDeleteRequiresCorrectKey(t *testing.T) {
+	ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	payload := generateRandomBytes(512)
+	req, _ := http.NewRequest("POST", ts.URL+"/api/v2/post/", bytes.NewReader(payload))
+	req.Header.Set("Origin", validOrigin)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	var uploadResp UploadResponse
+	json.NewDecoder(resp.Body).Decode(&uploadResp)
+	resp.Body.Close()
+
+	// Wrong delete key is rejected.
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/v2/"+uploadResp.DataKey, nil)
+	req.Header.Set("X-Delete-Key", "wrong-key")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send delete: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for wrong delete key; got %v", resp.StatusCode)
+	}
+
+	// Correct delete key succeeds and removes the object.
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/v2/"+uploadResp.DataKey, nil)
+	req.Header.Set("X-Delete-Key", uploadResp.DeleteKey)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send delete: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 for correct delete key; got %v", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v2/" + uploadResp.DataKey)
+	if err != nil {
+		t.Fatalf("failed to retrieve deleted data: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 after deletion; got %v", resp.StatusCode)
+	}
+}
+
+// Test case: the janitor removes a file whose metadata says it has expired.
+func TestJanitorRemovesExpiredFile(t *testing.T) {
+	if err := os.MkdirAll(testDataDir, 0755); err != nil {
+		t.Fatalf("failed to create test data dir: %v", err)
+	}
+
+	key := "janitor-expired-key"
+	if err := os.WriteFile(filepath.Join(dataDir, key), []byte("stale data"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	expiredAt := time.Now().Add(-time.Hour)
+	if err := writeMetadata(key, fileMetadata{
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: &expiredAt,
+		Size:      10,
+		SHA256:    key,
+		DeleteKey: "irrelevant",
+	}); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+
+	server := &Server{}
+	server.janitorSweep()
+
+	if _, err := os.Stat(filepath.Join(dataDir, key)); !os.IsNotExist(err) {
+		t.Error("expected expired file to be removed by the janitor")
+	}
+	if _, err := os.Stat(metadataPath(key)); !os.IsNotExist(err) {
+		t.Error("expected expired file's metadata to be removed by the janitor")
+	}
+}
+
+// Test case: the janitor discovers objects via their metadata sidecars and
+// deletes through the Storage interface, so expiry still works when the
+// object's bytes aren't under dataDir at all (as with the s3/gcs backends,
+// where only the sidecar is local).
+func TestJanitorUsesStorageInterface(t *testing.T) {
+	if err := os.MkdirAll(testDataDir, 0755); err != nil {
+		t.Fatalf("failed to create test data dir: %v", err)
+	}
+
+	key := "janitor-storage-only-key"
+	expiredAt := time.Now().Add(-time.Hour)
+	if err := writeMetadata(key, fileMetadata{
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: &expiredAt,
+		Size:      10,
+		SHA256:    key,
+		DeleteKey: "irrelevant",
+	}); err != nil {
+		t.Fatalf("failed to write metadata: %v", err)
+	}
+
+	storage := newFSStorage(testDataDir)
+	if err := storage.Put(context.Background(), key, bytes.NewReader([]byte("stale data")), 10); err != nil {
+		t.Fatalf("failed to put test object: %v", err)
+	}
+
+	server := &Server{storage: storage}
+	server.janitorSweep()
+
+	if _, err := storage.Stat(context.Background(), key); !os.IsNotExist(err) {
+		t.Error("expected expired object to be removed via the Storage interface")
+	}
+	if _, err := os.Stat(metadataPath(key)); !os.IsNotExist(err) {
+		t.Error("expected expired file's metadata to be removed by the janitor")
+	}
+}
+
+// Test case: the janitor also sweeps abandoned tus uploads past their
+// ExpiresAt, so a resumable upload that's created but never finished
+// doesn't keep its temp file and bookkeeping around forever.
+func TestJanitorSweepsExpiredTusUploads(t *testing.T) {
+	if err := os.MkdirAll(testDataDir, 0755); err != nil {
+		t.Fatalf("failed to create test data dir: %v", err)
+	}
+
+	server := &Server{}
+	store, err := server.ensureTusStore()
+	if err != nil {
+		t.Fatalf("failed to initialize tus store: %v", err)
+	}
+
+	upload, err := store.Create(1024, false)
+	if err != nil {
+		t.Fatalf("failed to create tus upload: %v", err)
+	}
+	upload.ExpiresAt = time.Now().Add(-time.Hour)
+
+	server.janitorSweep()
+
+	if _, err := store.Get(upload.ID); !os.IsNotExist(err) {
+		t.Error("expected expired tus upload to be dropped from the store")
+	}
+	tempPath := filepath.Join(dataDir, tusTmpDirName, upload.ID)
+	if _, err := os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Error("expected expired tus upload's temp file to be removed")
+	}
+}
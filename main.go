@@ -1,13 +1,16 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -19,7 +22,8 @@ const (
 )
 
 var (
-	dataDir = getDataDir() // Directory to store files
+	dataDir    = getDataDir() // Directory to store files
+	corsConfig = loadCORSConfig()
 )
 
 func init() {
@@ -38,13 +42,43 @@ func getDataDir() string {
 	return "./data"
 }
 
+const presignExpiry = 15 * time.Minute
+
 type Server struct {
 	mu sync.RWMutex
+
+	// tusStore backs the resumable-upload endpoints (see tus.go). It is
+	// lazily initialized on first use via ensureTusStore.
+	tusStore TusStore
+
+	// storage backs handleUpload/handleDownload (see storage.go). It is
+	// lazily initialized on first use via ensureStorage.
+	storage Storage
+}
+
+// ensureStorage lazily initializes the server's Storage backend from the
+// STORAGE_BACKEND environment variable.
+func (s *Server) ensureStorage() (Storage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.storage != nil {
+		return s.storage, nil
+	}
+
+	storage, err := newStorage()
+	if err != nil {
+		return nil, err
+	}
+	s.storage = storage
+	return storage, nil
 }
 
 type UploadResponse struct {
-	DataKey string `json:"dataKey"`
-	URL     string `json:"url"`
+	DataKey   string `json:"dataKey"`
+	URL       string `json:"url"`
+	Expiry    *int64 `json:"expiry,omitempty"` // unix timestamp the upload expires at, if any
+	DeleteKey string `json:"deleteKey"`
 }
 
 func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
@@ -53,39 +87,26 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// CORS headers for upload
-	origin := r.Header.Get("Origin")
-	// In production, you should validate the origin against a whitelist
-	w.Header().Set("Access-Control-Allow-Origin", origin)
-	w.Header().Set("Access-Control-Allow-Methods", "POST")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	expiresIn, err := parseExpiresIn(r.Header.Get("X-Expires-In"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		slog.Error("failed to create data directory", "error", err)
+	storage, err := s.ensureStorage()
+	if err != nil {
+		slog.Error("failed to initialize storage backend", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	// Generate a unique filename
-	dataKey := generateUniqueID()
-	filePath := filepath.Join(dataDir, dataKey)
-
-	// Create the file
-	file, err := os.Create(filePath)
+	// The dataKey is the content's SHA-256 digest, so identical uploads
+	// dedup onto the same stored object.
+	dataKey, size, err := PutContentAddressed(r.Context(), storage, r.Body)
 	if err != nil {
-		slog.Error("failed to create file", "error", err, "path", filePath)
-		http.Error(w, "Could not create file", http.StatusInternalServerError)
-		return
-	}
-	defer file.Close()
-
-	// Copy the data
-	if _, err := io.Copy(file, r.Body); err != nil {
-		slog.Error("failed to copy data", "error", err)
-		os.Remove(filePath) // Clean up on error
+		slog.Error("failed to store upload", "error", err)
 
 		// Check if the error is due to request body being too large
 		if err.Error() == "http: request body too large" {
@@ -97,6 +118,32 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deleteKey, err := generateDeleteKey()
+	if err != nil {
+		slog.Error("failed to generate delete key", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	meta := fileMetadata{
+		CreatedAt: time.Now(),
+		Size:      size,
+		SHA256:    dataKey,
+		DeleteKey: deleteKey,
+	}
+	var expiryUnix *int64
+	if expiresIn > 0 {
+		expiresAt := meta.CreatedAt.Add(expiresIn)
+		meta.ExpiresAt = &expiresAt
+		unix := expiresAt.Unix()
+		expiryUnix = &unix
+	}
+	if err := writeMetadata(dataKey, meta); err != nil {
+		slog.Error("failed to write upload metadata", "error", err, "dataKey", dataKey)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	// Construct the response
 	scheme := "http"
 	if r.TLS != nil {
@@ -105,60 +152,168 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	url := fmt.Sprintf("%s://%s/api/v2/%s", scheme, r.Host, dataKey)
 
 	response := UploadResponse{
-		DataKey: dataKey,
-		URL:     url,
+		DataKey:   dataKey,
+		URL:       url,
+		Expiry:    expiryUnix,
+		DeleteKey: deleteKey,
 	}
 
+	w.Header().Set("ETag", etagFor(dataKey))
+
 	slog.Info("file uploaded successfully",
 		"dataKey", dataKey,
-		"size", r.ContentLength,
-		"origin", origin,
+		"size", size,
+		"origin", r.Header.Get("Origin"),
 	)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseExpiresIn parses the X-Expires-In header (seconds) and caps it at
+// MAX_EXPIRY. An empty header means no expiry.
+func parseExpiresIn(header string) (time.Duration, error) {
+	if header == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid X-Expires-In value")
+	}
+
+	requested := time.Duration(seconds) * time.Second
+	if cap := maxExpiry(); cap > 0 && requested > cap {
+		requested = cap
+	}
+	return requested, nil
+}
+
 func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetObject(w, r)
+	case http.MethodDelete:
+		s.handleDeleteObject(w, r)
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
 
-	// CORS headers for download - more permissive
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET")
-
+func (s *Server) handleGetObject(w http.ResponseWriter, r *http.Request) {
 	// Extract the dataKey from the URL path
 	dataKey := filepath.Base(r.URL.Path)
-	filePath := filepath.Join(dataDir, dataKey)
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	storage, err := s.ensureStorage()
+	if err != nil {
+		slog.Error("failed to initialize storage backend", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := storage.Stat(r.Context(), dataKey); os.IsNotExist(err) {
 		slog.Warn("file not found", "dataKey", dataKey)
 		http.Error(w, "Could not find the file", http.StatusNotFound)
 		return
 	}
 
-	// Open and serve the file
-	file, err := os.Open(filePath)
+	if os.Getenv("PRESIGN") == "true" {
+		presignedURL, err := storage.PresignGet(r.Context(), dataKey, presignExpiry)
+		if err == nil {
+			slog.Info("redirecting to presigned URL", "dataKey", dataKey)
+			http.Redirect(w, r, presignedURL, http.StatusFound)
+			return
+		}
+		if !errors.Is(err, ErrPresignNotSupported) {
+			slog.Error("failed to presign download URL", "error", err, "dataKey", dataKey)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	file, _, err := storage.Get(r.Context(), dataKey)
 	if err != nil {
-		slog.Error("failed to open file", "error", err, "path", filePath)
+		slog.Error("failed to open file", "error", err, "dataKey", dataKey)
 		http.Error(w, "Could not read the file", http.StatusInternalServerError)
 		return
 	}
 	defer file.Close()
 
+	// Verify the stored content still hashes to its own key before serving
+	// any of it, so corruption is surfaced instead of silently returned.
+	// This spools through a temp file rather than buffering in memory, so
+	// a large object doesn't have to fit in the app's RAM just to be
+	// verified (see verifyDigestSpooled).
+	spooled, size, cleanup, err := verifyDigestSpooled(file, dataKey)
+	if err != nil {
+		slog.Error("stored file failed integrity check", "error", err, "dataKey", dataKey)
+		http.Error(w, "Stored data failed integrity check", http.StatusBadGateway)
+		return
+	}
+	defer cleanup()
+	defer spooled.Close()
+
+	etag := etagFor(dataKey)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/octet-stream")
-	if _, err := io.Copy(w, file); err != nil {
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	if _, err := io.Copy(w, spooled); err != nil {
 		slog.Error("failed to send file", "error", err, "dataKey", dataKey)
 	} else {
 		slog.Info("file downloaded successfully", "dataKey", dataKey)
 	}
 }
 
+// handleDeleteObject removes an uploaded object, authenticated by the
+// delete_key returned alongside it at upload time.
+func (s *Server) handleDeleteObject(w http.ResponseWriter, r *http.Request) {
+	dataKey := filepath.Base(r.URL.Path)
+
+	meta, err := readMetadata(dataKey)
+	if os.IsNotExist(err) {
+		http.Error(w, "Could not find the file", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to read upload metadata", "error", err, "dataKey", dataKey)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Delete-Key")), []byte(meta.DeleteKey)) != 1 {
+		http.Error(w, "Invalid delete key", http.StatusForbidden)
+		return
+	}
+
+	storage, err := s.ensureStorage()
+	if err != nil {
+		slog.Error("failed to initialize storage backend", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := storage.Delete(r.Context(), dataKey); err != nil {
+		slog.Error("failed to delete object", "error", err, "dataKey", dataKey)
+		http.Error(w, "Could not delete the file", http.StatusInternalServerError)
+		return
+	}
+	if err := deleteMetadata(dataKey); err != nil {
+		slog.Error("failed to delete upload metadata", "error", err, "dataKey", dataKey)
+	}
+
+	slog.Info("file deleted", "dataKey", dataKey)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// generateUniqueID returns a non-content-addressed key, used for
+// resumable uploads whose final size/digest isn't known until they
+// complete (see tus.go). Single-shot uploads use PutContentAddressed instead.
 func generateUniqueID() string {
-	// Simple implementation - in production you might want something more sophisticated
 	return fmt.Sprintf("%d", os.Getpid()) + fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
@@ -170,9 +325,14 @@ func main() {
 
 	server := &Server{}
 
+	server.startJanitor()
+
 	// Set up routes
-	http.HandleFunc("/api/v2/post/", server.handleUpload)
-	http.HandleFunc("/api/v2/", server.handleDownload)
+	http.HandleFunc("/api/v2/post/", corsConfig.middleware(server.handleUpload))
+	http.HandleFunc("/api/v2/uploads/", corsConfig.middleware(server.handleTusUploads))
+	http.HandleFunc("/api/v2/batch", corsConfig.middleware(server.handleBatch))
+	http.HandleFunc("/api/v2/batch/objects/", corsConfig.middleware(server.handleBatchObject))
+	http.HandleFunc("/api/v2/", corsConfig.middleware(server.handleDownload))
 
 	// Start the server
 	port := os.Getenv("PORT")
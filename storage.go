@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrPresignNotSupported is returned by Storage.PresignGet when the backend
+// has no notion of presigned URLs (e.g. the filesystem backend).
+var ErrPresignNotSupported = errors.New("storage: presigned URLs not supported by this backend")
+
+// Storage abstracts where uploaded scene data lives so handleUpload and
+// handleDownload don't need to know whether they're talking to the local
+// filesystem or an object store.
+type Storage interface {
+	// Put writes size bytes from r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns a reader for key and its size. Callers must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Stat returns the size of key, or an error satisfying os.IsNotExist if absent.
+	Stat(ctx context.Context, key string) (int64, error)
+	// Delete removes key. It is not an error if key does not exist.
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a time-limited URL clients can download key from
+	// directly, bypassing the app. Returns ErrPresignNotSupported if the
+	// backend can't do this (e.g. filesystem).
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// newStorage selects a Storage implementation based on the STORAGE_BACKEND
+// environment variable ("fs", "s3", or "gcs"), defaulting to "fs".
+func newStorage() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "fs", "filesystem":
+		return newFSStorage(dataDir), nil
+	case "s3":
+		return newS3StorageFromEnv()
+	case "gcs":
+		return newGCSStorageFromEnv()
+	default:
+		return nil, errors.New("storage: unknown STORAGE_BACKEND " + backend)
+	}
+}
+
+// fsStorage is the default Storage backend: files live directly under a
+// directory on local disk, matching the store's original behavior.
+type fsStorage struct {
+	dir string
+}
+
+func newFSStorage(dir string) *fsStorage {
+	return &fsStorage{dir: dir}
+}
+
+func (s *fsStorage) path(key string) string {
+	return filepath.Join(s.dir, key)
+}
+
+func (s *fsStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(s.path(key))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (s *fsStorage) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+func (s *fsStorage) Stat(ctx context.Context, key string) (int64, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *fsStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *fsStorage) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// gcsStorage stores objects in a Google Cloud Storage bucket.
+type gcsStorage struct {
+	client         *storage.Client
+	bucket         string
+	presignEmail   string
+	presignKeyFile string
+}
+
+// newGCSStorageFromEnv builds a gcsStorage from GCS_* environment
+// variables.
+//
+//   - GCS_BUCKET (required)
+//   - GOOGLE_APPLICATION_CREDENTIALS is used as usual by the client library
+//     for authentication
+//   - GCS_PRESIGN_SERVICE_ACCOUNT / GCS_PRESIGN_KEY_FILE (optional, required
+//     to sign URLs when running with workload identity rather than a key file)
+func newGCSStorageFromEnv() (*gcsStorage, error) {
+	bucket := os.Getenv("GCS_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("storage: GCS_BUCKET must be set for STORAGE_BACKEND=gcs")
+	}
+
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("storage: creating GCS client: %w", err)
+	}
+
+	return &gcsStorage{
+		client:         client,
+		bucket:         bucket,
+		presignEmail:   os.Getenv("GCS_PRESIGN_SERVICE_ACCOUNT"),
+		presignKeyFile: os.Getenv("GCS_PRESIGN_KEY_FILE"),
+	}, nil
+}
+
+func (s *gcsStorage) object(key string) *storage.ObjectHandle {
+	return s.client.Bucket(s.bucket).Object(key)
+}
+
+func (s *gcsStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	w := s.object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *gcsStorage) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	r, err := s.object(key).NewReader(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, r.Attrs.Size, nil
+}
+
+func (s *gcsStorage) Stat(ctx context.Context, key string) (int64, error) {
+	attrs, err := s.object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return 0, os.ErrNotExist
+		}
+		return 0, err
+	}
+	return attrs.Size, nil
+}
+
+func (s *gcsStorage) Delete(ctx context.Context, key string) error {
+	err := s.object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *gcsStorage) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	opts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(expiry),
+	}
+	if s.presignEmail != "" {
+		opts.GoogleAccessID = s.presignEmail
+	}
+	if s.presignKeyFile != "" {
+		keyData, err := os.ReadFile(s.presignKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("storage: reading GCS_PRESIGN_KEY_FILE: %w", err)
+		}
+		opts.PrivateKey = keyData
+	}
+
+	return s.client.Bucket(s.bucket).SignedURL(key, opts)
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	tusResumableVersion = "1.0.0"
+	tusUploadExpiry     = 24 * time.Hour
+	tusTmpDirName       = "tus-tmp"
+)
+
+// tusUpload tracks the state of a single in-progress resumable upload.
+type tusUpload struct {
+	ID          string
+	Offset      int64
+	Length      int64
+	DeferLength bool
+	ExpiresAt   time.Time
+	tempPath    string
+
+	// mu serializes Append calls for this upload, so the offset
+	// check-then-write-then-update is atomic even if a client (or a buggy
+	// one) fires concurrent PATCHes at the same upload.
+	mu sync.Mutex
+}
+
+// TusStore persists in-progress upload state. The default implementation
+// keeps state in memory and data in a temp directory under dataDir, but it
+// is pluggable so a future backend (e.g. Redis, object storage) can be
+// swapped in without touching the handlers.
+type TusStore interface {
+	Create(length int64, deferLength bool) (*tusUpload, error)
+	Get(id string) (*tusUpload, error)
+	Append(id string, offset int64, r io.Reader) (int64, error)
+	SetLength(id string, length int64) error
+	// Open returns a reader over a completed upload's bytes, for the
+	// caller to hand off to permanent storage.
+	Open(id string) (io.ReadCloser, error)
+	Delete(id string) error
+	// Sweep drops bookkeeping and temp data for uploads whose ExpiresAt is
+	// before now, so abandoned resumable uploads don't accumulate disk
+	// usage forever. It's called by the janitor (see lifecycle.go).
+	Sweep(now time.Time)
+}
+
+// memTusStore is the default TusStore: upload metadata in memory, chunks
+// appended directly to a file on disk.
+type memTusStore struct {
+	mu      sync.Mutex
+	uploads map[string]*tusUpload
+	dir     string
+}
+
+func newMemTusStore(dir string) (*memTusStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &memTusStore{
+		uploads: make(map[string]*tusUpload),
+		dir:     dir,
+	}, nil
+}
+
+func (s *memTusStore) Create(length int64, deferLength bool) (*tusUpload, error) {
+	id, err := newTusID()
+	if err != nil {
+		return nil, err
+	}
+	tempPath := filepath.Join(s.dir, id)
+
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	upload := &tusUpload{
+		ID:          id,
+		Length:      length,
+		DeferLength: deferLength,
+		ExpiresAt:   time.Now().Add(tusUploadExpiry),
+		tempPath:    tempPath,
+	}
+
+	s.mu.Lock()
+	s.uploads[id] = upload
+	s.mu.Unlock()
+
+	return upload, nil
+}
+
+func (s *memTusStore) Get(id string) (*tusUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return upload, nil
+}
+
+func (s *memTusStore) Append(id string, offset int64, r io.Reader) (int64, error) {
+	s.mu.Lock()
+	upload, ok := s.uploads[id]
+	s.mu.Unlock()
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	if upload.Offset != offset {
+		return 0, errUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(upload.tempPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(f, r)
+	if err != nil {
+		return written, err
+	}
+
+	upload.Offset += written
+
+	return written, nil
+}
+
+func (s *memTusStore) SetLength(id string, length int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok {
+		return os.ErrNotExist
+	}
+	upload.Length = length
+	upload.DeferLength = false
+	return nil
+}
+
+func (s *memTusStore) Open(id string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	upload, ok := s.uploads[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(upload.tempPath)
+}
+
+func (s *memTusStore) Delete(id string) error {
+	s.mu.Lock()
+	upload, ok := s.uploads[id]
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	if !ok {
+		return os.ErrNotExist
+	}
+	return os.Remove(upload.tempPath)
+}
+
+func (s *memTusStore) Sweep(now time.Time) {
+	s.mu.Lock()
+	var expired []*tusUpload
+	for id, upload := range s.uploads {
+		if upload.ExpiresAt.Before(now) {
+			expired = append(expired, upload)
+			delete(s.uploads, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, upload := range expired {
+		if err := os.Remove(upload.tempPath); err != nil && !os.IsNotExist(err) {
+			slog.Warn("janitor: failed to remove expired tus temp file", "error", err, "id", upload.ID)
+		} else {
+			slog.Info("janitor: removing expired tus upload", "id", upload.ID)
+		}
+	}
+}
+
+// errUploadOffsetMismatch is returned by TusStore.Append when the client's
+// reported offset doesn't match the server's recorded offset.
+var errUploadOffsetMismatch = fmt.Errorf("tus: upload offset mismatch")
+
+// newTusID returns a random hex identifier for a new resumable upload.
+func newTusID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ensureTusStore lazily initializes the server's resumable-upload store.
+func (s *Server) ensureTusStore() (TusStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tusStore != nil {
+		return s.tusStore, nil
+	}
+
+	store, err := newMemTusStore(filepath.Join(dataDir, tusTmpDirName))
+	if err != nil {
+		return nil, err
+	}
+	s.tusStore = store
+	return store, nil
+}
+
+func setTusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusResumableVersion)
+	w.Header().Set("Tus-Version", tusResumableVersion)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+	w.Header().Set("Tus-Extension", "creation,creation-defer-length")
+}
+
+// handleTusUploads serves the tus.io resumable-upload endpoints: creating
+// an upload, querying its offset, appending bytes, and preflight.
+func (s *Server) handleTusUploads(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		s.handleTusCreate(w, r)
+	case http.MethodHead:
+		s.handleTusHead(w, r)
+	case http.MethodPatch:
+		s.handleTusPatch(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleTusCreate(w http.ResponseWriter, r *http.Request) {
+	store, err := s.ensureTusStore()
+	if err != nil {
+		slog.Error("failed to initialize tus store", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	deferLength := r.Header.Get("Upload-Defer-Length") == "1"
+
+	var length int64
+	if !deferLength {
+		lengthHeader := r.Header.Get("Upload-Length")
+		if lengthHeader == "" {
+			http.Error(w, "Missing Upload-Length or Upload-Defer-Length", http.StatusBadRequest)
+			return
+		}
+		length, err = strconv.ParseInt(lengthHeader, 10, 64)
+		if err != nil || length < 0 {
+			http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+			return
+		}
+		if length > maxUploadSize {
+			http.Error(w, fmt.Sprintf("Upload-Length exceeds maximum of %d bytes", maxUploadSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	upload, err := store.Create(length, deferLength)
+	if err != nil {
+		slog.Error("failed to create tus upload", "error", err)
+		http.Error(w, "Could not create upload", http.StatusInternalServerError)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v2/uploads/%s", upload.ID)
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+
+	slog.Info("tus upload created", "id", upload.ID, "length", length, "deferLength", deferLength)
+}
+
+func (s *Server) handleTusHead(w http.ResponseWriter, r *http.Request) {
+	id := filepath.Base(r.URL.Path)
+
+	store, err := s.ensureTusStore()
+	if err != nil {
+		slog.Error("failed to initialize tus store", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	upload, err := store.Get(id)
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	if upload.DeferLength {
+		w.Header().Set("Upload-Defer-Length", "1")
+	} else {
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleTusPatch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id := filepath.Base(r.URL.Path)
+
+	offsetHeader := r.Header.Get("Upload-Offset")
+	offset, err := strconv.ParseInt(offsetHeader, 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	store, err := s.ensureTusStore()
+	if err != nil {
+		slog.Error("failed to initialize tus store", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	upload, err := store.Get(id)
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	if lengthHeader := r.Header.Get("Upload-Length"); lengthHeader != "" && upload.DeferLength {
+		length, err := strconv.ParseInt(lengthHeader, 10, 64)
+		if err != nil || length < 0 {
+			http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+			return
+		}
+		if err := store.SetLength(id, length); err != nil {
+			http.Error(w, "Could not set upload length", http.StatusInternalServerError)
+			return
+		}
+		upload.Length = length
+		upload.DeferLength = false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	written, err := store.Append(id, offset, r.Body)
+	if err == errUploadOffsetMismatch {
+		http.Error(w, "Upload-Offset does not match", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to append to tus upload", "error", err, "id", id)
+		http.Error(w, "Could not write chunk", http.StatusInternalServerError)
+		return
+	}
+
+	newOffset := offset + written
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+
+	if !upload.DeferLength && newOffset >= upload.Length {
+		dataKey, err := s.finalizeTusUpload(r.Context(), store, upload)
+		if err != nil {
+			slog.Error("failed to finalize tus upload", "error", err, "id", id)
+			http.Error(w, "Could not finalize upload", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Data-Key", dataKey)
+		slog.Info("tus upload completed", "id", id, "dataKey", dataKey)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finalizeTusUpload hands a completed resumable upload's bytes to the
+// server's Storage backend under a content-addressed key, the same way
+// handleUpload does for single-shot uploads, then drops the tus store's
+// bookkeeping for it.
+func (s *Server) finalizeTusUpload(ctx context.Context, store TusStore, upload *tusUpload) (string, error) {
+	storage, err := s.ensureStorage()
+	if err != nil {
+		return "", err
+	}
+
+	r, err := store.Open(upload.ID)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	dataKey, size, err := PutContentAddressed(ctx, storage, r)
+	if err != nil {
+		return "", err
+	}
+
+	deleteKey, err := generateDeleteKey()
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeMetadata(dataKey, fileMetadata{
+		CreatedAt: time.Now(),
+		Size:      size,
+		SHA256:    dataKey,
+		DeleteKey: deleteKey,
+	}); err != nil {
+		return "", err
+	}
+
+	if err := store.Delete(upload.ID); err != nil {
+		slog.Warn("failed to clean up tus temp file", "error", err, "id", upload.ID)
+	}
+
+	return dataKey, nil
+}